@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// defaultTimeout bounds how long a single fetch may take, including any
+// redirects it follows.
+const defaultTimeout = 15 * time.Second
+
+// maxRedirects caps how many hops Fetch will follow before giving up, so a
+// redirect loop can't hang a crawl worker forever.
+const maxRedirects = 10
+
+// RequestTimeout is the per-request timeout used by every fetch in a crawl.
+// main sets it once, from the --timeout flag, before the crawl starts.
+var RequestTimeout = defaultTimeout
+
+// AllowDowngrade controls whether an HTTPS->HTTP redirect hop is followed.
+// main sets it once, from the --allow-downgrade flag, before the crawl starts.
+var AllowDowngrade = false
+
+// sharedTransport is reused across every request a crawl makes, so
+// connections are pooled and the system's proxy configuration is honored,
+// unlike a fresh http.Transport built per call.
+var sharedTransport = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+}
+
+// checkRedirectPolicy returns a CheckRedirect func that appends every hop's
+// url to chain and enforces insecres' redirect policy: a bounded chain
+// length, and no HTTPS->HTTP downgrade unless AllowDowngrade is set.
+func checkRedirectPolicy(chain *[]string) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		*chain = append(*chain, req.URL.String())
+
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+
+		last := via[len(via)-1]
+		if !AllowDowngrade && last.URL.Scheme == "https" && req.URL.Scheme == "http" {
+			return fmt.Errorf("refusing to follow HTTPS->HTTP redirect from %s to %s (use --allow-downgrade to override)", last.URL, req.URL)
+		}
+
+		return nil
+	}
+}
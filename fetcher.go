@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// FetchResult bundles everything a single page fetch can produce: the
+// insecure resources and same-site links found on it, the chain of
+// redirects followed to reach it, its HTTP status, and the validators to
+// send on the next conditional request for the same url.
+type FetchResult struct {
+	InsecureResourceUrls []ResourceFinding
+	PageUrls             []string
+	RedirectChain        []string
+	HttpStatus           int
+	Conditional          conditionalHeaders
+	NotModified          bool
+}
+
+// Fetcher is implemented by anything that can fetch a page, honoring
+// conditional request validators, and return the insecure resources and
+// same-site links found on it.
+type Fetcher interface {
+	Fetch(url string, conditional conditionalHeaders) (FetchResult, error)
+}
+
+// InsecureResourceFetcher combines ResourceAndLinkFinder's Fetch and Parse
+// steps into the single call crawl needs from a Fetcher. When Warc is set,
+// it also archives every fetched page (and, if WarcResources is set, every
+// insecure resource found on it) as a WARC response record.
+type InsecureResourceFetcher struct {
+	Warc          *WarcWriter
+	WarcResources bool
+}
+
+// Fetch retrieves url and parses it, returning the insecure resources and the
+// same-site links discovered on the page.
+func (f InsecureResourceFetcher) Fetch(url string, conditional conditionalHeaders) (FetchResult, error) {
+	finder := ResourceAndLinkFinder{}
+
+	resourceUrls, pageUrls, meta, rawBody, err := finder.FetchAndParse(url, conditional)
+	if err != nil {
+		return FetchResult{}, err
+	}
+
+	if f.Warc != nil && !meta.NotModified {
+		if err := f.Warc.WriteResponse(url, meta.StatusLine, meta.Headers, rawBody); err != nil {
+			fmt.Fprintf(os.Stderr, "Error occured: %v\n", err)
+		}
+
+		if f.WarcResources {
+			for _, resourceFinding := range resourceUrls {
+				f.captureResource(resourceFinding.Url)
+			}
+		}
+	}
+
+	return FetchResult{
+		InsecureResourceUrls: resourceUrls,
+		PageUrls:             pageUrls,
+		RedirectChain:        meta.RedirectChain,
+		HttpStatus:           meta.StatusCode,
+		Conditional:          meta.Conditional(),
+		NotModified:          meta.NotModified,
+	}, nil
+}
+
+// captureResource fetches resourceUrl purely to record its HTTP transaction
+// in the WARC archive, so a reviewer can later confirm the finding offline.
+// A failed capture does not fail the page fetch it was found on.
+func (f InsecureResourceFetcher) captureResource(resourceUrl string) {
+	finder := ResourceAndLinkFinder{}
+
+	body, meta, err := finder.Fetch(resourceUrl, conditionalHeaders{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error occured: %v\n", err)
+		return
+	}
+	defer body.Close()
+
+	rawBody, err := io.ReadAll(body)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error occured: %v\n", err)
+		return
+	}
+
+	if err := f.Warc.WriteResponse(resourceUrl, meta.StatusLine, meta.Headers, rawBody); err != nil {
+		fmt.Fprintf(os.Stderr, "Error occured: %v\n", err)
+	}
+}
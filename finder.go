@@ -1,45 +1,140 @@
 package main
 
 import (
-	"crypto/tls"
+	"bytes"
 	"fmt"
 	"golang.org/x/net/html"
 	"io"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strings"
 )
 
 // ResourceAndLinkFinder encapsulates logic that is used for finding page link urls and resource urls..
 type ResourceAndLinkFinder struct{}
 
-// Fetch page by url and returns response body.
-func (f ResourceAndLinkFinder) Fetch(url string) (responseBody io.ReadCloser, err error) {
-	transport := &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
+// ResourceFinding describes a single insecure resource reference together with
+// the tag/attribute it was found in, so callers can tell an http:// script src
+// apart from an http:// stylesheet import.
+type ResourceFinding struct {
+	Url       string
+	Tag       string
+	Attribute string
+}
+
+// cssUrlPattern matches url(...) references, with or without quotes, as they
+// appear in stylesheets and inline style attributes.
+var cssUrlPattern = regexp.MustCompile(`url\(\s*['"]?([^'")]+)['"]?\s*\)`)
+
+// cssImportPattern matches @import "..." / @import '...' references that are
+// not already wrapped in url(...).
+var cssImportPattern = regexp.MustCompile(`@import\s+['"]([^'"]+)['"]`)
+
+// cssImageSetPattern matches the quoted URL candidates of an image-set(...)
+// declaration, e.g. image-set("a.jpg" 1x, "b.jpg" 2x).
+var cssImageSetPattern = regexp.MustCompile(`image-set\(([^)]*)\)`)
+
+// cssImageSetEntryPattern extracts the quoted URL out of a single image-set
+// candidate entry.
+var cssImageSetEntryPattern = regexp.MustCompile(`['"]([^'"]+)['"]`)
+
+// FetchMeta describes everything about an HTTP transaction other than the
+// body: where it ultimately landed, how it got there, and what came back in
+// the status line and headers.
+type FetchMeta struct {
+	FinalUrl      string
+	RedirectChain []string
+	StatusCode    int
+	StatusLine    string
+	Headers       http.Header
+	NotModified   bool
+}
+
+// Conditional derives the validators (ETag, Last-Modified) a later fetch of
+// the same url should send as If-None-Match / If-Modified-Since.
+func (m FetchMeta) Conditional() conditionalHeaders {
+	return conditionalHeaders{
+		ETag:         m.Headers.Get("ETag"),
+		LastModified: m.Headers.Get("Last-Modified"),
 	}
+}
 
-	client := http.Client{Transport: transport}
+// Fetch retrieves url, following redirects under insecres' redirect policy
+// (bounded depth, no HTTPS->HTTP downgrade unless AllowDowngrade is set).
+// If conditional carries a previously recorded ETag or Last-Modified value,
+// it is sent as If-None-Match / If-Modified-Since; meta.NotModified reports
+// whether the server answered 304, in which case responseBody is nil.
+// The caller is responsible for closing responseBody.
+func (f ResourceAndLinkFinder) Fetch(url string, conditional conditionalHeaders) (responseBody io.ReadCloser, meta FetchMeta, err error) {
+	client := &http.Client{
+		Transport:     sharedTransport,
+		Timeout:       RequestTimeout,
+		CheckRedirect: checkRedirectPolicy(&meta.RedirectChain),
+	}
 
-	response, err := client.Get(url)
+	request, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
-		return nil, err
+		return nil, meta, err
+	}
+	if conditional.ETag != "" {
+		request.Header.Set("If-None-Match", conditional.ETag)
 	}
-	//defer response.Body.Close()
+	if conditional.LastModified != "" {
+		request.Header.Set("If-Modified-Since", conditional.LastModified)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, meta, err
+	}
+
+	meta.FinalUrl = response.Request.URL.String()
+	meta.StatusCode = response.StatusCode
+	meta.StatusLine = fmt.Sprintf("%s %s", response.Proto, response.Status)
+	meta.Headers = response.Header
 
-	return response.Body, nil
+	if response.StatusCode == http.StatusNotModified {
+		response.Body.Close()
+		meta.NotModified = true
+		return nil, meta, nil
+	}
+
+	return response.Body, meta, nil
+}
+
+// FetchAndParse fetches url and parses the page it ultimately resolves to,
+// guaranteeing the response body is closed. Relative resource and link urls
+// are resolved against the final, post-redirect url rather than the url
+// originally requested, so a resource found only after an HTTPS->HTTP hop is
+// still reported as insecure. If the server reports the page unchanged since
+// conditional was last recorded, meta.NotModified is true and no parsing
+// happens. rawBody holds the exact bytes read from the wire, for callers
+// (such as the WARC writer) that need the original response alongside the
+// parsed results.
+func (f ResourceAndLinkFinder) FetchAndParse(url string, conditional conditionalHeaders) (resourceUrls []ResourceFinding, linkUrls []string, meta FetchMeta, rawBody []byte, err error) {
+	body, meta, err := f.Fetch(url, conditional)
+	if err != nil || meta.NotModified {
+		return nil, nil, meta, nil, err
+	}
+	defer body.Close()
+
+	var captured bytes.Buffer
+	resourceUrls, linkUrls, err = f.Parse(meta.FinalUrl, io.TeeReader(body, &captured))
+	return resourceUrls, linkUrls, meta, captured.Bytes(), err
 }
 
 // Parse takes a reader object and returns a slice of insecure resource urls
 // found in the HTML.
 // It does not close the reader. The reader should be closed from the outside.
-func (f ResourceAndLinkFinder) Parse(baseUrl string, httpBody io.Reader) (resourceUrls []string, linkUrls []string, err error) {
+func (f ResourceAndLinkFinder) Parse(baseUrl string, httpBody io.Reader) (resourceUrls []ResourceFinding, linkUrls []string, err error) {
 
-	resourceMap := make(map[string]bool)
+	resourceMap := make(map[string]ResourceFinding)
 	linkMap := make(map[string]bool)
 
+	inStyleTag := false
+	var styleTagContent strings.Builder
+
 	page := html.NewTokenizer(httpBody)
 	for {
 		tokenType := page.Next()
@@ -48,15 +143,41 @@ func (f ResourceAndLinkFinder) Parse(baseUrl string, httpBody io.Reader) (resour
 		}
 		token := page.Token()
 
+		// Inline <style> blocks arrive as a TextToken between the start and
+		// end tag, so they have to be accumulated and parsed separately from
+		// the tag-attribute matrix below.
+		if inStyleTag {
+			switch tokenType {
+			case html.TextToken:
+				styleTagContent.WriteString(token.Data)
+				continue
+			case html.EndTagToken:
+				if token.Data == "style" {
+					for _, uri := range f.processStyleContent(styleTagContent.String()) {
+						resourceMap[uri] = ResourceFinding{Url: uri, Tag: "style", Attribute: "url()"}
+					}
+					inStyleTag = false
+					styleTagContent.Reset()
+				}
+				continue
+			}
+		}
+
+		if token.Type == html.StartTagToken && token.Data == "style" {
+			inStyleTag = true
+			styleTagContent.Reset()
+			continue
+		}
+
 		switch {
 		case f.isResourceToken(token):
-			uris, err := f.processResourceToken(token)
+			findings, err := f.processResourceToken(token)
 			if err != nil {
 				continue
 			}
 
-			for _, uri := range uris {
-				resourceMap[uri] = true
+			for _, finding := range findings {
+				resourceMap[finding.Url] = finding
 			}
 		case f.isLinkToken(token):
 			uri, err := f.processLinkToken(token, baseUrl)
@@ -66,12 +187,24 @@ func (f ResourceAndLinkFinder) Parse(baseUrl string, httpBody io.Reader) (resour
 
 			linkMap[uri] = true
 		}
+
+		// A style="..." attribute can appear on any element, so it is
+		// checked independently of the tag-specific resource matrix above.
+		for _, attr := range token.Attr {
+			if attr.Key != "style" {
+				continue
+			}
+
+			for _, uri := range f.processStyleContent(attr.Val) {
+				resourceMap[uri] = ResourceFinding{Url: uri, Tag: token.Data, Attribute: "style"}
+			}
+		}
 	}
 
-	resourceUrls = make([]string, 0, len(resourceMap))
+	resourceUrls = make([]ResourceFinding, 0, len(resourceMap))
 
-	for k := range resourceMap {
-		resourceUrls = append(resourceUrls, k)
+	for _, finding := range resourceMap {
+		resourceUrls = append(resourceUrls, finding)
 	}
 
 	linkUrls = make([]string, 0, len(linkMap))
@@ -87,17 +220,37 @@ func (f ResourceAndLinkFinder) Parse(baseUrl string, httpBody io.Reader) (resour
 func (f ResourceAndLinkFinder) isResourceToken(token html.Token) bool {
 
 	switch {
-	case token.Type == html.SelfClosingTagToken && token.Data == "img":
-		return true
-	case token.Type == html.StartTagToken:
+	case token.Type == html.StartTagToken || token.Type == html.SelfClosingTagToken:
 		switch token.Data {
 		case
+			"img",
 			"iframe",
 			"object",
 			"video",
 			"audio",
 			"source",
-			"track":
+			"track",
+			"script",
+			"form",
+			"use":
+			return true
+		case "link":
+			return f.isResourceLinkTag(token)
+		}
+	}
+	return false
+}
+
+// Determine whether a <link> tag's rel attribute is one insecres cares about
+// (stylesheet and preload are the ones that can pull in mixed content).
+func (f ResourceAndLinkFinder) isResourceLinkTag(token html.Token) bool {
+	for _, attr := range token.Attr {
+		if attr.Key != "rel" {
+			continue
+		}
+
+		switch strings.ToLower(strings.TrimSpace(attr.Val)) {
+		case "stylesheet", "preload":
 			return true
 		}
 	}
@@ -111,6 +264,22 @@ func (f ResourceAndLinkFinder) isTargetedResourceTokenAttribute(token html.Token
 		return true
 	}
 
+	if token.Data == "form" && attribute.Key == "action" {
+		return true
+	}
+
+	if token.Data == "use" && (attribute.Key == "xlink:href" || attribute.Key == "href") {
+		return true
+	}
+
+	if (token.Data == "img" || token.Data == "source") && attribute.Key == "srcset" {
+		return true
+	}
+
+	if token.Data == "link" && attribute.Key == "href" {
+		return true
+	}
+
 	if attribute.Key == "src" || attribute.Key == "poster" {
 		return true
 	}
@@ -119,9 +288,9 @@ func (f ResourceAndLinkFinder) isTargetedResourceTokenAttribute(token html.Token
 }
 
 // Process resource token in order to get urls of the resources (a few if it is video, for example).
-func (f ResourceAndLinkFinder) processResourceToken(token html.Token) (map[string]string, error) {
+func (f ResourceAndLinkFinder) processResourceToken(token html.Token) ([]ResourceFinding, error) {
 
-	result := make(map[string]string)
+	var result []ResourceFinding
 
 	// Loop for tag attributes.
 	for _, attr := range token.Attr {
@@ -130,17 +299,18 @@ func (f ResourceAndLinkFinder) processResourceToken(token html.Token) (map[strin
 			continue
 		}
 
-		uri, err := url.Parse(attr.Val)
-		if err != nil {
+		if attr.Key == "srcset" {
+			for _, candidateUrl := range f.parseSrcset(attr.Val) {
+				if finding, ok := f.toInsecureFinding(token.Data, attr.Key, candidateUrl); ok {
+					result = append(result, finding)
+				}
+			}
 			continue
 		}
 
-		// Ignore relative and secure urls.
-		if !uri.IsAbs() || uri.Scheme == "https" || (uri.Host != "" && strings.HasPrefix(uri.String(), "//")) {
-			continue
+		if finding, ok := f.toInsecureFinding(token.Data, attr.Key, attr.Val); ok {
+			result = append(result, finding)
 		}
-
-		result[attr.Key] = uri.String()
 	}
 
 	if len(result) == 0 {
@@ -150,6 +320,82 @@ func (f ResourceAndLinkFinder) processResourceToken(token html.Token) (map[strin
 	return result, nil
 }
 
+// toInsecureFinding parses rawUrl and, if it is an absolute insecure (http)
+// url, returns a ResourceFinding describing where it came from.
+func (f ResourceAndLinkFinder) toInsecureFinding(tag string, attribute string, rawUrl string) (ResourceFinding, bool) {
+	uri, err := url.Parse(rawUrl)
+	if err != nil {
+		return ResourceFinding{}, false
+	}
+
+	// Ignore relative and secure urls.
+	if !uri.IsAbs() || uri.Scheme == "https" || (uri.Host != "" && strings.HasPrefix(uri.String(), "//")) {
+		return ResourceFinding{}, false
+	}
+
+	return ResourceFinding{Url: uri.String(), Tag: tag, Attribute: attribute}, true
+}
+
+// parseSrcset splits a srcset attribute value into its candidate URLs,
+// stripping the trailing width/density descriptor (e.g. "2x", "480w") from
+// each comma-separated entry.
+func (f ResourceAndLinkFinder) parseSrcset(srcset string) []string {
+	var urls []string
+
+	for _, candidate := range strings.Split(srcset, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "" {
+			continue
+		}
+
+		fields := strings.Fields(candidate)
+		if len(fields) == 0 {
+			continue
+		}
+
+		urls = append(urls, fields[0])
+	}
+
+	return urls
+}
+
+// processStyleContent walks a chunk of CSS (either the text content of an
+// inline <style> block or the value of a style="..." attribute) and returns
+// the insecure urls referenced via url(...), @import "..." and image-set(...).
+func (f ResourceAndLinkFinder) processStyleContent(css string) []string {
+	var urls []string
+
+	for _, match := range cssUrlPattern.FindAllStringSubmatch(css, -1) {
+		urls = append(urls, match[1])
+	}
+
+	for _, match := range cssImportPattern.FindAllStringSubmatch(css, -1) {
+		urls = append(urls, match[1])
+	}
+
+	for _, match := range cssImageSetPattern.FindAllStringSubmatch(css, -1) {
+		for _, entry := range cssImageSetEntryPattern.FindAllStringSubmatch(match[1], -1) {
+			urls = append(urls, entry[1])
+		}
+	}
+
+	var insecureUrls []string
+	for _, rawUrl := range urls {
+		uri, err := url.Parse(strings.TrimSpace(rawUrl))
+		if err != nil {
+			continue
+		}
+
+		if !uri.IsAbs() || uri.Scheme == "https" || (uri.Host != "" && strings.HasPrefix(uri.String(), "//")) {
+			continue
+		}
+
+		insecureUrls = append(insecureUrls, uri.String())
+	}
+
+	return insecureUrls
+}
+
 // Determine whether the token passed is a link token.
 func (f ResourceAndLinkFinder) isLinkToken(token html.Token) bool {
 	switch {
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSrcset(t *testing.T) {
+	tests := []struct {
+		name   string
+		srcset string
+		want   []string
+	}{
+		{
+			name:   "single candidate without descriptor",
+			srcset: "http://example.com/a.jpg",
+			want:   []string{"http://example.com/a.jpg"},
+		},
+		{
+			name:   "multiple candidates with width and density descriptors",
+			srcset: "http://example.com/a.jpg 480w, http://example.com/b.jpg 2x",
+			want:   []string{"http://example.com/a.jpg", "http://example.com/b.jpg"},
+		},
+		{
+			name:   "ignores empty entries from stray commas",
+			srcset: "http://example.com/a.jpg 1x, , http://example.com/b.jpg 2x",
+			want:   []string{"http://example.com/a.jpg", "http://example.com/b.jpg"},
+		},
+		{
+			name:   "empty input",
+			srcset: "",
+			want:   nil,
+		},
+	}
+
+	finder := ResourceAndLinkFinder{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := finder.parseSrcset(tt.srcset)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSrcset(%q) = %v, want %v", tt.srcset, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessStyleContent(t *testing.T) {
+	tests := []struct {
+		name string
+		css  string
+		want []string
+	}{
+		{
+			name: "insecure url()",
+			css:  `background: url(http://example.com/bg.png);`,
+			want: []string{"http://example.com/bg.png"},
+		},
+		{
+			name: "secure url() is ignored",
+			css:  `background: url(https://example.com/bg.png);`,
+			want: nil,
+		},
+		{
+			name: "quoted url()",
+			css:  `background: url('http://example.com/bg.png');`,
+			want: []string{"http://example.com/bg.png"},
+		},
+		{
+			name: "@import",
+			css:  `@import "http://example.com/style.css";`,
+			want: []string{"http://example.com/style.css"},
+		},
+		{
+			name: "image-set with multiple candidates",
+			css:  `background: image-set("http://example.com/a.jpg" 1x, "http://example.com/b.jpg" 2x);`,
+			want: []string{"http://example.com/a.jpg", "http://example.com/b.jpg"},
+		},
+		{
+			name: "relative url() is ignored",
+			css:  `background: url(/bg.png);`,
+			want: nil,
+		},
+	}
+
+	finder := ResourceAndLinkFinder{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := finder.processStyleContent(tt.css)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("processStyleContent(%q) = %v, want %v", tt.css, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,71 +1,158 @@
 package main
 
 import (
-	"fmt"
-	"time"
+	"errors"
 	"flag"
+	"fmt"
 	"os"
-	"errors"
+	"sync"
 )
 
-// Goroutine function fetches and parses the passed url in order to find insecure resources and next urls to fetch from.
-func fetchUrl(url string, queue chan string, registry *Registry) {
-
-	// Lock url so that no one other goroutine can process it.
-	registry.MarkAsProcessed(url)
+// fetchUrl fetches url, reports and persists any insecure resources it
+// carries, and enqueues the same-site links found on it.
+func fetchUrl(url string, store *Store, reporter Reporter, fetcher Fetcher) {
 
-	fetcher := InsecureResourceFetcher{}
+	conditional, err := store.Headers(url)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error occured: %v\n", err)
+		return
+	}
 
-	insecureResourceUrls, pageUrls, err := fetcher.Fetch(url)
+	result, err := fetcher.Fetch(url, conditional)
 	if err != nil {
-		fmt.Errorf("Error occured: %v", err)
+		fmt.Fprintf(os.Stderr, "Error occured: %v\n", err)
+		if err := store.MarkVisited(url); err != nil {
+			fmt.Fprintf(os.Stderr, "Error occured: %v\n", err)
+		}
 		return
 	}
 
-	for _, insecureResourceUrl := range insecureResourceUrls {
-		fmt.Printf("%s: %s\n", url, insecureResourceUrl)
+	if err := store.SaveHeaders(url, result.Conditional); err != nil {
+		fmt.Fprintf(os.Stderr, "Error occured: %v\n", err)
 	}
 
-	for _, url := range pageUrls {
-		queue <- url
+	if !result.NotModified {
+		findings := make([]Finding, 0, len(result.InsecureResourceUrls))
+		for _, resourceFinding := range result.InsecureResourceUrls {
+			findings = append(findings, Finding{
+				PageUrl:       url,
+				ResourceUrl:   resourceFinding.Url,
+				Tag:           resourceFinding.Tag,
+				Attribute:     resourceFinding.Attribute,
+				RedirectChain: result.RedirectChain,
+				HttpStatus:    result.HttpStatus,
+			})
+		}
+
+		for _, finding := range findings {
+			reporter.Report(finding)
+		}
+
+		// Replacing (rather than appending) keeps a re-run idempotent: a
+		// changed page's stale findings are dropped, and a page that became
+		// secure ends up with none persisted at all.
+		if err := store.ReplaceFindings(url, findings); err != nil {
+			fmt.Fprintf(os.Stderr, "Error occured: %v\n", err)
+		}
+
+		if err := store.SaveLinks(url, result.PageUrls); err != nil {
+			fmt.Fprintf(os.Stderr, "Error occured: %v\n", err)
+		}
+
+		for _, pageUrl := range result.PageUrls {
+			if err := store.Enqueue(pageUrl); err != nil {
+				fmt.Fprintf(os.Stderr, "Error occured: %v\n", err)
+			}
+		}
+	} else {
+		// The page is unchanged, so it was never re-parsed for links. Replay
+		// the out-links recorded the last time it was fetched, so a crawl
+		// that crashed before enqueuing a parent's children still discovers
+		// them on resume.
+		links, err := store.Links(url)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error occured: %v\n", err)
+		}
+
+		for _, pageUrl := range links {
+			if err := store.Enqueue(pageUrl); err != nil {
+				fmt.Fprintf(os.Stderr, "Error occured: %v\n", err)
+			}
+		}
 	}
 
+	if err := store.MarkVisited(url); err != nil {
+		fmt.Fprintf(os.Stderr, "Error occured: %v\n", err)
+	}
 }
 
-// Crawl pages starting with url and find insecure resources.
-func crawl(url string, fetcher Fetcher) {
+// Crawl pages starting with url and find insecure resources. The frontier is
+// kept in store, so progress survives a crash: termination is a proper
+// WaitGroup over active fetches plus an empty queue, not a wall-clock tick.
+// Work is handed to a bounded pool of concurrency workers, each honoring
+// robots.txt and a per-host rate limit before fetching.
+func crawl(url string, fetcher Fetcher, reporter Reporter, store *Store, robots *RobotsCache, limiter *HostRateLimiter, concurrency int) error {
 
-	registry := &Registry{processed: make(map[string]int)}
-
-	queue := make(chan string)
+	if err := store.Enqueue(url); err != nil {
+		return err
+	}
 
-	go fetchUrl(url, queue, registry)
+	jobs := make(chan string)
+	var active sync.WaitGroup
 
-	tick := time.Tick(2000 * time.Millisecond)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			for nextUrl := range jobs {
+				processJob(nextUrl, store, reporter, fetcher, robots, limiter)
+				active.Done()
+			}
+		}()
+	}
 
-	flag := false
 	for {
-		select {
-		case url := <-queue:
-			flag = false
+		nextUrl, ok, err := store.Dequeue()
+		if err != nil {
+			close(jobs)
+			return err
+		}
+
+		if !ok {
+			// The queue looks empty, but fetches still in flight may enqueue
+			// more urls once they finish, so wait for them before deciding
+			// the crawl is actually done.
+			active.Wait()
 
-			// Ignore processed urls.
-			if !registry.IsNew(url) {
-				continue
+			empty, err := store.IsEmpty()
+			if err != nil {
+				close(jobs)
+				return err
 			}
-			go fetchUrl(url, queue, registry)
-		case <-tick:
-			if flag {
-				fmt.Println("-----")
-				fmt.Printf("log:\n")
-				fmt.Println(registry)
-				return
-			} else {
-				flag = true
+			if empty {
+				close(jobs)
+				return nil
 			}
+			continue
+		}
+
+		active.Add(1)
+		jobs <- nextUrl
+	}
+
+}
+
+// processJob enforces robots.txt and the per-host rate limit for url, then
+// fetches it unless robots.txt disallows it.
+func processJob(url string, store *Store, reporter Reporter, fetcher Fetcher, robots *RobotsCache, limiter *HostRateLimiter) {
+	if !robots.Allowed(url) {
+		if err := store.MarkVisited(url); err != nil {
+			fmt.Fprintf(os.Stderr, "Error occured: %v\n", err)
 		}
+		return
 	}
 
+	limiter.Wait(url, robots.CrawlDelay(url))
+
+	fetchUrl(url, store, reporter, fetcher)
 }
 
 func startUrl() (string, error) {
@@ -82,11 +169,88 @@ func startUrl() (string, error) {
 
 func main() {
 
-	startUrl, err := startUrl();
+	formatFlag := flag.String("format", "text", "Report format: text, ndjson, or sarif")
+	outputFlag := flag.String("output", "", "Write the report here instead of stdout")
+	timeoutFlag := flag.Duration("timeout", defaultTimeout, "Per-request timeout, including redirects")
+	allowDowngradeFlag := flag.Bool("allow-downgrade", false, "Follow HTTPS->HTTP redirect hops instead of refusing them")
+	stateFlag := flag.String("state", "insecres.db", "Path to the crawl's persistent state database")
+	concurrencyFlag := flag.Int("concurrency", 10, "Number of pages to fetch at once")
+	rpsFlag := flag.Float64("rps", 2, "Maximum requests per second to any single host")
+	burstFlag := flag.Int("burst", 5, "Maximum burst of requests to any single host")
+	warcFlag := flag.String("warc", "", "Directory to write a WARC archive of the crawl into")
+	warcResourcesFlag := flag.Bool("warc-resources", false, "Also archive every insecure resource found, not just the pages (requires --warc)")
+	warcMaxSizeFlag := flag.Int64("warc-max-size", defaultWarcMaxFileSize, "Rotate to a new WARC file after this many bytes")
+
+	startUrl, err := startUrl()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	RequestTimeout = *timeoutFlag
+	AllowDowngrade = *allowDowngradeFlag
+
+	out := os.Stdout
+	if *outputFlag != "" {
+		file, err := os.Create(*outputFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	reporter, err := newReporter(*formatFlag, out)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	store, err := OpenStore(*stateFlag)
 	if err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
+	defer store.Close()
 
-	crawl(startUrl, InsecureResourceFetcher{})
+	// Replay findings from a previous, interrupted run of this crawl so a
+	// resumed report is complete even though only changed pages get refetched.
+	findings, err := store.Findings()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for _, finding := range findings {
+		reporter.Report(finding)
+	}
+
+	if err := seedFromSitemap(startUrl, store); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	robots := NewRobotsCache()
+	limiter := NewHostRateLimiter(*rpsFlag, *burstFlag)
+
+	fetcher := InsecureResourceFetcher{WarcResources: *warcResourcesFlag}
+	if *warcFlag != "" {
+		warc, err := NewWarcWriter(*warcFlag, *warcMaxSizeFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer warc.Close()
+		fetcher.Warc = warc
+	}
+
+	if err := crawl(startUrl, fetcher, reporter, store, robots, limiter, *concurrencyFlag); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if err := reporter.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
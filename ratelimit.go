@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// HostRateLimiter enforces a requests-per-second budget per host, so a
+// crawl with a large worker pool can't hammer a single origin regardless of
+// how many of its urls happen to be queued at once.
+type HostRateLimiter struct {
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+	rps      float64
+	burst    int
+}
+
+// NewHostRateLimiter returns a limiter allowing rps requests per second to
+// any one host, with the given burst.
+func NewHostRateLimiter(rps float64, burst int) *HostRateLimiter {
+	return &HostRateLimiter{
+		limiters: make(map[string]*rate.Limiter),
+		rps:      rps,
+		burst:    burst,
+	}
+}
+
+// Wait blocks until rawUrl's host may be fetched, honoring both the
+// configured requests-per-second budget and crawlDelay (as asked for by the
+// host's robots.txt), whichever takes longer.
+func (l *HostRateLimiter) Wait(rawUrl string, crawlDelay time.Duration) {
+	uri, err := url.Parse(rawUrl)
+	if err != nil {
+		return
+	}
+
+	l.limiterFor(uri.Host).Wait(context.Background())
+
+	if crawlDelay > 0 {
+		time.Sleep(crawlDelay)
+	}
+}
+
+func (l *HostRateLimiter) limiterFor(host string) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limiter, ok := l.limiters[host]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(l.rps), l.burst)
+		l.limiters[host] = limiter
+	}
+
+	return limiter
+}
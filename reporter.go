@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Finding describes a single insecure resource reference discovered on a
+// crawled page.
+type Finding struct {
+	PageUrl       string   `json:"page_url"`
+	ResourceUrl   string   `json:"resource_url"`
+	Tag           string   `json:"tag"`
+	Attribute     string   `json:"attribute"`
+	RedirectChain []string `json:"redirect_chain,omitempty"`
+	HttpStatus    int      `json:"http_status,omitempty"`
+}
+
+// Reporter receives findings as they are discovered during a crawl and turns
+// them into a report in some output format.
+type Reporter interface {
+	// Report records a single finding.
+	Report(finding Finding)
+	// Flush writes any buffered output. It must be called once the crawl is done.
+	Flush() error
+}
+
+// newReporter builds the Reporter named by format, writing to out.
+func newReporter(format string, out io.Writer) (Reporter, error) {
+	switch format {
+	case "", "text":
+		return NewTextReporter(out), nil
+	case "ndjson":
+		return NewNDJSONReporter(out), nil
+	case "sarif":
+		return NewSARIFReporter(out), nil
+	default:
+		return nil, fmt.Errorf("unknown report format %q, want one of: text, ndjson, sarif", format)
+	}
+}
+
+// TextReporter reproduces insecres' original "pageUrl: resourceUrl" output.
+type TextReporter struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// NewTextReporter returns a Reporter that writes plain text, one finding per line.
+func NewTextReporter(out io.Writer) *TextReporter {
+	return &TextReporter{out: out}
+}
+
+// Report is safe to call concurrently: crawl's worker pool calls Report from
+// every worker goroutine, so writes to out must not interleave.
+func (r *TextReporter) Report(finding Finding) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fmt.Fprintf(r.out, "%s: %s\n", finding.PageUrl, finding.ResourceUrl)
+}
+
+func (r *TextReporter) Flush() error {
+	return nil
+}
+
+// NDJSONReporter writes one JSON-encoded Finding per line, suitable for
+// streaming into log pipelines and CI tooling.
+type NDJSONReporter struct {
+	mu  sync.Mutex
+	out io.Writer
+	enc *json.Encoder
+}
+
+// NewNDJSONReporter returns a Reporter that writes newline-delimited JSON.
+func NewNDJSONReporter(out io.Writer) *NDJSONReporter {
+	return &NDJSONReporter{out: out, enc: json.NewEncoder(out)}
+}
+
+// Report is safe to call concurrently: crawl's worker pool calls Report from
+// every worker goroutine, and json.Encoder is not safe for concurrent use on
+// its own.
+func (r *NDJSONReporter) Report(finding Finding) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Encoding errors here would mean the output stream itself is broken;
+	// there is nothing more useful to do than drop the line.
+	_ = r.enc.Encode(finding)
+}
+
+func (r *NDJSONReporter) Flush() error {
+	return nil
+}
+
+// sarifRuleId is the single rule insecres reports results under.
+const sarifRuleId = "mixed-content-resource"
+
+// SARIFReporter buffers findings and emits a SARIF 2.1.0 log on Flush, with
+// results grouped per page so the report can be consumed by GitHub code
+// scanning and similar dashboards.
+type SARIFReporter struct {
+	mu       sync.Mutex
+	out      io.Writer
+	findings []Finding
+}
+
+// NewSARIFReporter returns a Reporter that emits a single SARIF document on Flush.
+func NewSARIFReporter(out io.Writer) *SARIFReporter {
+	return &SARIFReporter{out: out}
+}
+
+// Report is safe to call concurrently: crawl's worker pool calls Report from
+// every worker goroutine, and appending to findings is not.
+func (r *SARIFReporter) Report(finding Finding) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.findings = append(r.findings, finding)
+}
+
+func (r *SARIFReporter) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	results := make([]sarifResult, 0, len(r.findings))
+
+	for _, finding := range r.findings {
+		results = append(results, sarifResult{
+			RuleId: sarifRuleId,
+			Message: sarifMessage{
+				Text: fmt.Sprintf("Insecure %s resource %q referenced via %s=%q", finding.Tag, finding.ResourceUrl, finding.Attribute, finding.ResourceUrl),
+			},
+			Locations: []sarifLocation{
+				{
+					PhysicalLocation: sarifPhysicalLocation{
+						ArtifactLocation: sarifArtifactLocation{Uri: finding.PageUrl},
+					},
+				},
+			},
+		})
+	}
+
+	log := sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://raw.githubusercontent.com/oasis-tcs/sarif-spec/master/Schemata/sarif-schema-2.1.0.json",
+		Runs: []sarifRun{
+			{
+				Tool: sarifTool{
+					Driver: sarifDriver{
+						Name: "insecres",
+						Rules: []sarifRule{
+							{
+								Id:   sarifRuleId,
+								Name: "MixedContentResource",
+								ShortDescription: sarifMessage{
+									Text: "Page references a resource over insecure HTTP",
+								},
+							},
+						},
+					},
+				},
+				Results: results,
+			},
+		},
+	}
+
+	enc := json.NewEncoder(r.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log)
+}
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	Id               string       `json:"id"`
+	Name             string       `json:"name"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifResult struct {
+	RuleId    string          `json:"ruleId"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	Uri string `json:"uri"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
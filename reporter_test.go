@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestSARIFReporterFlush(t *testing.T) {
+	var out bytes.Buffer
+	reporter := NewSARIFReporter(&out)
+
+	reporter.Report(Finding{
+		PageUrl:     "https://example.com/",
+		ResourceUrl: "http://example.com/script.js",
+		Tag:         "script",
+		Attribute:   "src",
+	})
+
+	if err := reporter.Flush(); err != nil {
+		t.Fatalf("Flush() returned error: %v", err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(out.Bytes(), &log); err != nil {
+		t.Fatalf("Flush() did not produce valid JSON: %v", err)
+	}
+
+	if log.Version != "2.1.0" {
+		t.Errorf("Version = %q, want 2.1.0", log.Version)
+	}
+
+	if len(log.Runs) != 1 {
+		t.Fatalf("len(Runs) = %d, want 1", len(log.Runs))
+	}
+
+	rules := log.Runs[0].Tool.Driver.Rules
+	if len(rules) != 1 || rules[0].Id != sarifRuleId {
+		t.Errorf("Rules = %v, want a single rule with id %q", rules, sarifRuleId)
+	}
+
+	results := log.Runs[0].Results
+	if len(results) != 1 {
+		t.Fatalf("len(Results) = %d, want 1", len(results))
+	}
+
+	if results[0].RuleId != sarifRuleId {
+		t.Errorf("Results[0].RuleId = %q, want %q", results[0].RuleId, sarifRuleId)
+	}
+
+	if got := results[0].Locations[0].PhysicalLocation.ArtifactLocation.Uri; got != "https://example.com/" {
+		t.Errorf("Results[0] artifact uri = %q, want https://example.com/", got)
+	}
+}
+
+func TestSARIFReporterFlushWithNoFindings(t *testing.T) {
+	var out bytes.Buffer
+	reporter := NewSARIFReporter(&out)
+
+	if err := reporter.Flush(); err != nil {
+		t.Fatalf("Flush() returned error: %v", err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(out.Bytes(), &log); err != nil {
+		t.Fatalf("Flush() did not produce valid JSON: %v", err)
+	}
+
+	if len(log.Runs[0].Results) != 0 {
+		t.Errorf("len(Results) = %d, want 0", len(log.Runs[0].Results))
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// userAgent is the name insecres identifies itself as, both on the wire and
+// when looking for a matching robots.txt group.
+const userAgent = "insecres"
+
+// robotsRules is the parsed rule set that applies to us for a single host:
+// the Disallow prefixes and the Crawl-delay it asked for, if any.
+type robotsRules struct {
+	disallow   []string
+	crawlDelay time.Duration
+}
+
+// RobotsCache fetches and caches robots.txt per scheme+host, so each site is
+// only asked once per crawl no matter how many of its urls get queued.
+type RobotsCache struct {
+	mu    sync.Mutex
+	rules map[string]robotsRules
+}
+
+// NewRobotsCache returns an empty RobotsCache.
+func NewRobotsCache() *RobotsCache {
+	return &RobotsCache{rules: make(map[string]robotsRules)}
+}
+
+// Allowed reports whether rawUrl may be fetched under its host's robots.txt.
+func (c *RobotsCache) Allowed(rawUrl string) bool {
+	uri, err := url.Parse(rawUrl)
+	if err != nil {
+		return true
+	}
+
+	rules := c.rulesFor(uri)
+
+	for _, prefix := range rules.disallow {
+		if prefix != "" && strings.HasPrefix(uri.Path, prefix) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// CrawlDelay returns the Crawl-delay rawUrl's host asked for, or 0 if none was set.
+func (c *RobotsCache) CrawlDelay(rawUrl string) time.Duration {
+	uri, err := url.Parse(rawUrl)
+	if err != nil {
+		return 0
+	}
+
+	return c.rulesFor(uri).crawlDelay
+}
+
+// rulesFor returns the cached rules for uri's host, fetching and parsing its
+// robots.txt on first use. A robots.txt that can't be fetched or parsed is
+// treated as "everything allowed" and cached as such.
+func (c *RobotsCache) rulesFor(uri *url.URL) robotsRules {
+	key := uri.Scheme + "://" + uri.Host
+
+	c.mu.Lock()
+	rules, ok := c.rules[key]
+	c.mu.Unlock()
+	if ok {
+		return rules
+	}
+
+	rules, err := fetchRobotsRules(key + "/robots.txt")
+	if err != nil {
+		rules = robotsRules{}
+	}
+
+	c.mu.Lock()
+	c.rules[key] = rules
+	c.mu.Unlock()
+
+	return rules
+}
+
+// fetchRobotsRules downloads and parses robotsUrl.
+func fetchRobotsRules(robotsUrl string) (robotsRules, error) {
+	client := &http.Client{Transport: sharedTransport, Timeout: RequestTimeout}
+
+	response, err := client.Get(robotsUrl)
+	if err != nil {
+		return robotsRules{}, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return robotsRules{}, nil
+	}
+
+	return parseRobots(response.Body), nil
+}
+
+// parseRobots implements enough of the robots exclusion standard for
+// insecres' purposes: per-group Disallow prefixes and Crawl-delay, preferring
+// a group addressed to "insecres" and falling back to the wildcard group.
+func parseRobots(r io.Reader) robotsRules {
+	groups := map[string]robotsRules{}
+	var currentAgents []string
+	// agentsOpen is true while the current group is still only accumulating
+	// User-agent lines, so consecutive agents are merged into one group but
+	// a User-agent line that follows a rule starts a new one.
+	agentsOpen := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			currentAgents = nil
+			agentsOpen = false
+			continue
+		}
+
+		// Strip a trailing "# ..." comment; it ends the line, not the group.
+		if idx := strings.IndexByte(line, '#'); idx != -1 {
+			line = strings.TrimSpace(line[:idx])
+		}
+		if line == "" {
+			continue
+		}
+
+		field, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		field = strings.ToLower(strings.TrimSpace(field))
+		value = strings.TrimSpace(value)
+
+		if field != "user-agent" {
+			// Any directive other than User-agent closes the group's
+			// agent-accumulation phase, including ones insecres doesn't
+			// otherwise understand (e.g. Allow, Sitemap, Host), so a
+			// User-agent line that follows one of those still starts a
+			// new group instead of merging into this one.
+			agentsOpen = false
+		}
+
+		switch field {
+		case "user-agent":
+			agent := strings.ToLower(value)
+			if !agentsOpen {
+				currentAgents = nil
+			}
+			currentAgents = append(currentAgents, agent)
+			agentsOpen = true
+			if _, ok := groups[agent]; !ok {
+				groups[agent] = robotsRules{}
+			}
+		case "disallow":
+			for _, agent := range currentAgents {
+				rules := groups[agent]
+				rules.disallow = append(rules.disallow, value)
+				groups[agent] = rules
+			}
+		case "crawl-delay":
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			for _, agent := range currentAgents {
+				rules := groups[agent]
+				rules.crawlDelay = time.Duration(seconds * float64(time.Second))
+				groups[agent] = rules
+			}
+		}
+	}
+
+	if rules, ok := groups[strings.ToLower(userAgent)]; ok {
+		return rules
+	}
+
+	return groups["*"]
+}
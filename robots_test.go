@@ -0,0 +1,124 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRobotsWildcardFallback(t *testing.T) {
+	robots := strings.NewReader(`
+User-agent: *
+Disallow: /private/
+Crawl-delay: 2
+`)
+
+	rules := parseRobots(robots)
+
+	if len(rules.disallow) != 1 || rules.disallow[0] != "/private/" {
+		t.Errorf("disallow = %v, want [/private/]", rules.disallow)
+	}
+	if rules.crawlDelay != 2*time.Second {
+		t.Errorf("crawlDelay = %v, want 2s", rules.crawlDelay)
+	}
+}
+
+func TestParseRobotsPrefersInsecresGroup(t *testing.T) {
+	robots := strings.NewReader(`
+User-agent: *
+Disallow: /everyone/
+
+User-agent: insecres
+Disallow: /only-insecres/
+`)
+
+	rules := parseRobots(robots)
+
+	if len(rules.disallow) != 1 || rules.disallow[0] != "/only-insecres/" {
+		t.Errorf("disallow = %v, want [/only-insecres/]", rules.disallow)
+	}
+}
+
+func TestParseRobotsNoMatchingGroup(t *testing.T) {
+	robots := strings.NewReader(`
+User-agent: somebot
+Disallow: /somebot-only/
+`)
+
+	rules := parseRobots(robots)
+
+	if len(rules.disallow) != 0 {
+		t.Errorf("disallow = %v, want none", rules.disallow)
+	}
+}
+
+func TestParseRobotsGroupAppliesToMultipleAgents(t *testing.T) {
+	robots := strings.NewReader(`
+User-agent: somebot
+User-agent: insecres
+Disallow: /shared/
+`)
+
+	rules := parseRobots(robots)
+
+	if len(rules.disallow) != 1 || rules.disallow[0] != "/shared/" {
+		t.Errorf("disallow = %v, want [/shared/]", rules.disallow)
+	}
+}
+
+func TestParseRobotsCommentInsideGroupIsIgnored(t *testing.T) {
+	robots := strings.NewReader(`
+User-agent: insecres
+# a comment
+Disallow: /secret/
+`)
+
+	rules := parseRobots(robots)
+
+	if len(rules.disallow) != 1 || rules.disallow[0] != "/secret/" {
+		t.Errorf("disallow = %v, want [/secret/]", rules.disallow)
+	}
+}
+
+func TestParseRobotsTrailingCommentOnRuleIsStripped(t *testing.T) {
+	robots := strings.NewReader(`
+User-agent: insecres
+Disallow: /secret/ # keep out
+`)
+
+	rules := parseRobots(robots)
+
+	if len(rules.disallow) != 1 || rules.disallow[0] != "/secret/" {
+		t.Errorf("disallow = %v, want [/secret/]", rules.disallow)
+	}
+}
+
+func TestParseRobotsAgentAfterUnrecognizedDirectiveStartsNewGroup(t *testing.T) {
+	robots := strings.NewReader(`
+User-agent: insecres
+Allow: /
+User-agent: *
+Disallow: /
+`)
+
+	rules := parseRobots(robots)
+
+	if len(rules.disallow) != 0 {
+		t.Errorf("disallow = %v, want none (insecres' own group has no Disallow)", rules.disallow)
+	}
+}
+
+func TestParseRobotsAgentAfterRuleStartsNewGroup(t *testing.T) {
+	robots := strings.NewReader(`
+User-agent: insecres
+Disallow: /a/
+User-agent: googlebot
+Disallow: /b/
+`)
+
+	rules := parseRobots(robots)
+
+	if len(rules.disallow) != 1 || rules.disallow[0] != "/a/" {
+		t.Errorf("disallow = %v, want [/a/], not googlebot's rules", rules.disallow)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// sitemapUrlset is the root element of a sitemap.xml file.
+type sitemapUrlset struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Urls    []sitemapUrl `xml:"url"`
+}
+
+type sitemapUrl struct {
+	Loc string `xml:"loc"`
+}
+
+// sitemapIndex is the root element of a sitemap index file, which lists
+// further sitemap.xml files rather than pages directly.
+type sitemapIndex struct {
+	XMLName  xml.Name       `xml:"sitemapindex"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+type sitemapEntry struct {
+	Loc string `xml:"loc"`
+}
+
+// maxSitemapDepth guards against a pathological sitemap index that
+// references itself (directly or through a cycle of further indexes).
+const maxSitemapDepth = 5
+
+// seedFromSitemap looks for a sitemap.xml at siteUrl's root and enqueues
+// every page url it (transitively, through a sitemap index) lists, so link
+// discovery via <a href> isn't the crawl's only source of urls.
+func seedFromSitemap(siteUrl string, store *Store) error {
+	base, err := url.Parse(siteUrl)
+	if err != nil {
+		return err
+	}
+
+	return fetchSitemap(base.Scheme+"://"+base.Host+"/sitemap.xml", store, 0)
+}
+
+// fetchSitemap downloads sitemapUrl and enqueues the page urls it contains,
+// recursing into any sitemap index it turns out to be.
+func fetchSitemap(sitemapUrl string, store *Store, depth int) error {
+	if depth >= maxSitemapDepth {
+		return nil
+	}
+
+	client := &http.Client{Transport: sharedTransport, Timeout: RequestTimeout}
+
+	response, err := client.Get(sitemapUrl)
+	if err != nil {
+		// Most sites don't publish a sitemap; that's not an error for the crawl.
+		return nil
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil
+	}
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	var urlset sitemapUrlset
+	if err := xml.Unmarshal(body, &urlset); err == nil && len(urlset.Urls) > 0 {
+		for _, entry := range urlset.Urls {
+			if entry.Loc == "" {
+				continue
+			}
+			if err := store.Enqueue(entry.Loc); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var index sitemapIndex
+	if err := xml.Unmarshal(body, &index); err != nil {
+		return nil
+	}
+
+	for _, entry := range index.Sitemaps {
+		if entry.Loc == "" {
+			continue
+		}
+		if err := fetchSitemap(entry.Loc, store, depth+1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
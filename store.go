@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	bucketQueued   = []byte("queued")
+	bucketInFlight = []byte("in_flight")
+	bucketVisited  = []byte("visited")
+	bucketFindings = []byte("findings")
+	bucketHeaders  = []byte("headers")
+	bucketLinks    = []byte("links")
+)
+
+// conditionalHeaders are the validators a page returned, so a resumed crawl
+// can send If-None-Match / If-Modified-Since instead of re-fetching a page
+// whose content hasn't changed.
+type conditionalHeaders struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// Store persists the crawl frontier (queued/in-flight/visited urls),
+// findings, and per-url conditional-request headers in an embedded bbolt
+// database, so a crawl can be resumed after a crash without starting over.
+type Store struct {
+	db *bolt.DB
+}
+
+// OpenStore opens (creating if necessary) the bbolt database at path and
+// re-queues anything left in_flight by a previous, interrupted crawl.
+func OpenStore(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{bucketQueued, bucketInFlight, bucketVisited, bucketFindings, bucketHeaders, bucketLinks} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	store := &Store{db: db}
+	if err := store.requeueInFlight(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Close closes the underlying database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// requeueInFlight moves every url left in_flight by a crawl that crashed
+// mid-fetch back onto the queue.
+func (s *Store) requeueInFlight() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		inFlight := tx.Bucket(bucketInFlight)
+		queued := tx.Bucket(bucketQueued)
+
+		var stale [][]byte
+		err := inFlight.ForEach(func(k, v []byte) error {
+			stale = append(stale, append([]byte{}, k...))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, url := range stale {
+			if err := queued.Put(url, []byte{1}); err != nil {
+				return err
+			}
+			if err := inFlight.Delete(url); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Enqueue adds url to the frontier unless it has already been visited or is
+// already queued or in flight.
+func (s *Store) Enqueue(url string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		key := []byte(url)
+
+		if tx.Bucket(bucketVisited).Get(key) != nil {
+			return nil
+		}
+		if tx.Bucket(bucketQueued).Get(key) != nil {
+			return nil
+		}
+		if tx.Bucket(bucketInFlight).Get(key) != nil {
+			return nil
+		}
+
+		return tx.Bucket(bucketQueued).Put(key, []byte{1})
+	})
+}
+
+// Dequeue pops one url off the queue and marks it in flight. ok is false if
+// the queue is currently empty.
+func (s *Store) Dequeue() (url string, ok bool, err error) {
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		queued := tx.Bucket(bucketQueued)
+
+		k, _ := queued.Cursor().First()
+		if k == nil {
+			return nil
+		}
+
+		url = string(k)
+		ok = true
+
+		if err := tx.Bucket(bucketInFlight).Put(k, []byte{1}); err != nil {
+			return err
+		}
+		return queued.Delete(k)
+	})
+
+	return url, ok, err
+}
+
+// MarkVisited moves url from in_flight into visited once it has been fetched.
+func (s *Store) MarkVisited(url string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		key := []byte(url)
+
+		if err := tx.Bucket(bucketVisited).Put(key, []byte{1}); err != nil {
+			return err
+		}
+		return tx.Bucket(bucketInFlight).Delete(key)
+	})
+}
+
+// IsEmpty reports whether both the queue and the in-flight set are empty,
+// i.e. there is no more work left for the crawl to do.
+func (s *Store) IsEmpty() (bool, error) {
+	empty := true
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(bucketQueued).Stats().KeyN > 0 {
+			empty = false
+			return nil
+		}
+		if tx.Bucket(bucketInFlight).Stats().KeyN > 0 {
+			empty = false
+		}
+		return nil
+	})
+
+	return empty, err
+}
+
+// SaveHeaders records the validators a fetch of url returned.
+func (s *Store) SaveHeaders(url string, headers conditionalHeaders) error {
+	data, err := json.Marshal(headers)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketHeaders).Put([]byte(url), data)
+	})
+}
+
+// Headers returns the validators previously recorded for url, if any.
+func (s *Store) Headers(url string) (conditionalHeaders, error) {
+	var headers conditionalHeaders
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketHeaders).Get([]byte(url))
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal(data, &headers)
+	})
+
+	return headers, err
+}
+
+// SaveLinks records the out-links found on pageUrl, so they can be
+// rediscovered from a 304 response that never re-parses the page.
+func (s *Store) SaveLinks(pageUrl string, links []string) error {
+	data, err := json.Marshal(links)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketLinks).Put([]byte(pageUrl), data)
+	})
+}
+
+// Links returns the out-links previously recorded for pageUrl, if any.
+func (s *Store) Links(pageUrl string) ([]string, error) {
+	var links []string
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketLinks).Get([]byte(pageUrl))
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal(data, &links)
+	})
+
+	return links, err
+}
+
+// ReplaceFindings overwrites everything persisted for pageUrl with findings,
+// keyed by pageUrl so a re-run is idempotent: re-fetching a changed page
+// replaces its stale findings instead of piling duplicates on top of them,
+// and a page that became secure can be cleared by passing an empty slice.
+func (s *Store) ReplaceFindings(pageUrl string, findings []Finding) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketFindings)
+		key := []byte(pageUrl)
+
+		if len(findings) == 0 {
+			return bucket.Delete(key)
+		}
+
+		data, err := json.Marshal(findings)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(key, data)
+	})
+}
+
+// Findings returns every finding persisted so far, across all pages.
+func (s *Store) Findings() ([]Finding, error) {
+	var findings []Finding
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketFindings).ForEach(func(k, v []byte) error {
+			var pageFindings []Finding
+			if err := json.Unmarshal(v, &pageFindings); err != nil {
+				return err
+			}
+			findings = append(findings, pageFindings...)
+			return nil
+		})
+	})
+
+	return findings, err
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// defaultWarcMaxFileSize is the size a WARC file is rotated at when the user
+// doesn't specify one.
+const defaultWarcMaxFileSize = 1 << 30 // 1 GiB
+
+// WarcWriter writes HTTP transactions as gzip-per-record WARC 1.1 response
+// records, rotating to a new file once the current one reaches maxFileSize.
+// Each record is independently gzipped and the resulting members are
+// concatenated, which is what makes the output a valid .warc.gz stream.
+type WarcWriter struct {
+	mu          sync.Mutex
+	dir         string
+	maxFileSize int64
+	file        *os.File
+	fileSize    int64
+	fileIndex   int
+}
+
+// NewWarcWriter returns a WarcWriter that writes numbered .warc.gz files into
+// dir, creating it if necessary, rotating once a file reaches maxFileSize.
+func NewWarcWriter(dir string, maxFileSize int64) (*WarcWriter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &WarcWriter{dir: dir, maxFileSize: maxFileSize}, nil
+}
+
+// WriteResponse appends a WARC-Type: response record for targetUri, built
+// from the HTTP status line, headers and body of the transaction that
+// fetched it.
+func (w *WarcWriter) WriteResponse(targetUri string, statusLine string, headers http.Header, body []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	record, err := gzipRecord(buildWarcRecord(targetUri, statusLine, headers, body))
+	if err != nil {
+		return err
+	}
+
+	if w.file == nil {
+		if err := w.openNextFile(); err != nil {
+			return err
+		}
+	}
+
+	n, err := w.file.Write(record)
+	if err != nil {
+		return err
+	}
+	w.fileSize += int64(n)
+
+	if w.fileSize >= w.maxFileSize {
+		if err := w.file.Close(); err != nil {
+			return err
+		}
+		w.file = nil
+	}
+
+	return nil
+}
+
+// Close closes the file currently being written to, if any.
+func (w *WarcWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func (w *WarcWriter) openNextFile() error {
+	w.fileIndex++
+
+	path := filepath.Join(w.dir, fmt.Sprintf("insecres-%05d.warc.gz", w.fileIndex))
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	w.file = file
+	w.fileSize = 0
+	return nil
+}
+
+// buildWarcRecord serializes a single WARC 1.1 response record: the WARC
+// header block, followed by the raw HTTP response (status line, headers,
+// body) as the record's payload.
+func buildWarcRecord(targetUri string, statusLine string, headers http.Header, body []byte) []byte {
+	var payload bytes.Buffer
+	payload.WriteString(statusLine)
+	payload.WriteString("\r\n")
+	headers.Write(&payload)
+	payload.WriteString("\r\n")
+	payload.Write(body)
+
+	var record bytes.Buffer
+	record.WriteString("WARC/1.1\r\n")
+	fmt.Fprintf(&record, "WARC-Type: response\r\n")
+	fmt.Fprintf(&record, "WARC-Target-URI: %s\r\n", targetUri)
+	fmt.Fprintf(&record, "WARC-Date: %s\r\n", time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintf(&record, "WARC-Record-ID: %s\r\n", newWarcRecordId())
+	fmt.Fprintf(&record, "Content-Type: application/http; msgtype=response\r\n")
+	fmt.Fprintf(&record, "Content-Length: %d\r\n", payload.Len())
+	record.WriteString("\r\n")
+	record.Write(payload.Bytes())
+	record.WriteString("\r\n\r\n")
+
+	return record.Bytes()
+}
+
+// gzipRecord compresses record as its own gzip member, so concatenating many
+// of these together produces a valid multi-member gzip stream.
+func gzipRecord(record []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(record); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// newWarcRecordId returns a random UUIDv4 formatted as a WARC-Record-ID urn.
+func newWarcRecordId() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
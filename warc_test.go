@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var warcRecordIdPattern = regexp.MustCompile(`^<urn:uuid:[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}>$`)
+
+func TestBuildWarcRecord(t *testing.T) {
+	headers := http.Header{}
+	headers.Set("Content-Type", "text/html")
+
+	body := []byte("<html></html>")
+
+	record := buildWarcRecord("http://example.com/", "HTTP/1.1 200 OK", headers, body)
+	text := string(record)
+
+	if !strings.HasPrefix(text, "WARC/1.1\r\n") {
+		t.Errorf("record does not start with the WARC version line: %q", text[:20])
+	}
+
+	for _, want := range []string{
+		"WARC-Type: response\r\n",
+		"WARC-Target-URI: http://example.com/\r\n",
+		"Content-Type: application/http; msgtype=response\r\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("record missing header %q", want)
+		}
+	}
+
+	if !strings.Contains(text, "WARC-Record-ID: <urn:uuid:") {
+		t.Error("record missing a WARC-Record-ID")
+	}
+
+	if !strings.Contains(text, "HTTP/1.1 200 OK\r\n") {
+		t.Error("record payload missing the captured HTTP status line")
+	}
+
+	if !strings.Contains(text, string(body)) {
+		t.Error("record payload missing the captured HTTP body")
+	}
+}
+
+func TestNewWarcRecordIdIsUniqueAndVersion4(t *testing.T) {
+	a := newWarcRecordId()
+	b := newWarcRecordId()
+
+	if a == b {
+		t.Errorf("newWarcRecordId() returned the same id twice: %s", a)
+	}
+
+	if !warcRecordIdPattern.MatchString(a) {
+		t.Errorf("newWarcRecordId() = %s, want a version-4 UUID urn", a)
+	}
+}